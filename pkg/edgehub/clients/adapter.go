@@ -0,0 +1,41 @@
+package clients
+
+import (
+	"github.com/kubeedge/kubeedge/beehive/pkg/core/model"
+	"github.com/kubeedge/kubeedge/pkg/edgehub/config"
+)
+
+// ClientType identifies one of the transports EdgeHubController can use
+// to talk to cloudhub.
+type ClientType string
+
+const (
+	ClientTypeWebSocket ClientType = "websocket"
+	ClientTypeGRPC      ClientType = "grpc"
+	ClientTypeQUIC      ClientType = "quic"
+)
+
+// Adapter is the transport-agnostic interface EdgeHubController drives:
+// connect, send/receive model.Message, and tear down. Init/Uninit may be
+// called repeatedly across reconnects.
+type Adapter interface {
+	Init() error
+	Uninit()
+	Send(message model.Message) error
+	Receive() (model.Message, error)
+}
+
+// GetClient dispatches on the configured protocol and returns the
+// matching Adapter, or nil if the protocol is unrecognized.
+func GetClient(ctype ClientType, conf *config.Config) Adapter {
+	switch ctype {
+	case ClientTypeWebSocket:
+		return NewWebSocketClient(conf)
+	case ClientTypeGRPC:
+		return NewGRPCClient(conf)
+	case ClientTypeQUIC:
+		return NewQUICClient(conf)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,139 @@
+package clients
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding"
+
+	"github.com/kubeedge/kubeedge/beehive/pkg/common/log"
+	"github.com/kubeedge/kubeedge/beehive/pkg/core/model"
+	"github.com/kubeedge/kubeedge/pkg/edgehub/config"
+)
+
+// edgeHubStreamDesc describes the single bidi-streaming RPC used to
+// carry model.Message frames between edgehub and cloudhub. There is no
+// generated client here: the payload is just JSON over a raw grpc
+// stream, so there's nothing for protoc to generate.
+var edgeHubStreamDesc = &grpc.StreamDesc{
+	StreamName:    "MessageExchange",
+	ServerStreams: true,
+	ClientStreams: true,
+}
+
+// rawBytesCodecName is the content subtype requested on the stream so
+// grpc-go reaches for rawBytesCodec instead of its default proto codec,
+// which would type-assert every SendMsg/RecvMsg value to proto.Message
+// and reject the plain []byte frames below.
+const rawBytesCodecName = "edgehub-raw-bytes"
+
+// rawBytesCodec passes SendMsg/RecvMsg payloads through unmodified. Send
+// and Receive already do the JSON marshal/unmarshal themselves, so this
+// codec's only job is to stop grpc-go from trying (and failing) to treat
+// a []byte as a proto.Message.
+type rawBytesCodec struct{}
+
+func (rawBytesCodec) Name() string { return rawBytesCodecName }
+
+func (rawBytesCodec) Marshal(v interface{}) ([]byte, error) {
+	payload, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("rawBytesCodec: expected []byte, got %T", v)
+	}
+	return payload, nil
+}
+
+func (rawBytesCodec) Unmarshal(data []byte, v interface{}) error {
+	payload, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("rawBytesCodec: expected *[]byte, got %T", v)
+	}
+	*payload = data
+	return nil
+}
+
+func init() {
+	encoding.RegisterCodec(rawBytesCodec{})
+}
+
+// GRPCClient is an Adapter backed by a single bidirectional gRPC stream,
+// authenticated with the same cert/key pair as the websocket transport.
+type GRPCClient struct {
+	config *config.Config
+	conn   *grpc.ClientConn
+	stream grpc.ClientStream
+	sendMu sync.Mutex
+}
+
+func NewGRPCClient(conf *config.Config) *GRPCClient {
+	return &GRPCClient{config: conf}
+}
+
+func (c *GRPCClient) Init() error {
+	cert, err := tls.LoadX509KeyPair(c.config.WSConfig.CertFilePath, c.config.WSConfig.KeyFilePath)
+	if err != nil {
+		log.LOGGER.Errorf("failed to load x509 key pair: %v", err)
+		return err
+	}
+
+	creds := credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{cert}})
+	conn, err := grpc.Dial(c.config.WSConfig.Url, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		log.LOGGER.Errorf("failed to dial cloud hub over grpc: %v", err)
+		return err
+	}
+
+	stream, err := conn.NewStream(context.Background(), edgeHubStreamDesc, "/edgehub.EdgeHub/MessageExchange",
+		grpc.CallContentSubtype(rawBytesCodecName))
+	if err != nil {
+		conn.Close()
+		log.LOGGER.Errorf("failed to open grpc message exchange stream: %v", err)
+		return err
+	}
+
+	c.conn = conn
+	c.stream = stream
+	return nil
+}
+
+func (c *GRPCClient) Uninit() {
+	if c.stream != nil {
+		if err := c.stream.CloseSend(); err != nil {
+			log.LOGGER.Errorf("failed to close grpc stream: %v", err)
+		}
+	}
+	if c.conn != nil {
+		if err := c.conn.Close(); err != nil {
+			log.LOGGER.Errorf("failed to close grpc connection: %v", err)
+		}
+	}
+}
+
+func (c *GRPCClient) Send(message model.Message) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message, error: %v", err)
+	}
+
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	return c.stream.SendMsg(payload)
+}
+
+func (c *GRPCClient) Receive() (model.Message, error) {
+	var message model.Message
+	var payload []byte
+	if err := c.stream.RecvMsg(&payload); err != nil {
+		return message, err
+	}
+
+	if err := json.Unmarshal(payload, &message); err != nil {
+		return message, fmt.Errorf("failed to unmarshal message, error: %v", err)
+	}
+	return message, nil
+}
@@ -0,0 +1,83 @@
+package clients
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/kubeedge/kubeedge/beehive/pkg/core/model"
+	"github.com/kubeedge/kubeedge/pkg/edgehub/config"
+)
+
+// serveTestCloudHubOverGRPC starts a grpc server on listener that
+// handles every call - there's no generated service to register against,
+// same as GRPCClient's hand-rolled StreamDesc - recording every inbound
+// message into hub and replaying hub's backlog back to the client via
+// streamBacklog. It shares the rawBytesCodec GRPCClient registers in its
+// own init(), since the codec is process-wide and content-negotiated per
+// call rather than tied to a particular service.
+func serveTestCloudHubOverGRPC(t *testing.T, hub *testCloudHub, tlsConfig *tls.Config, listener net.Listener) {
+	t.Helper()
+
+	server := grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(tlsConfig)),
+		grpc.UnknownServiceHandler(func(srv interface{}, stream grpc.ServerStream) error {
+			stop := make(chan struct{})
+			defer close(stop)
+			go streamBacklog(hub, stop, func(message model.Message) error {
+				payload, err := json.Marshal(message)
+				if err != nil {
+					return err
+				}
+				return stream.SendMsg(payload)
+			})
+
+			for {
+				var payload []byte
+				if err := stream.RecvMsg(&payload); err != nil {
+					return nil
+				}
+
+				var message model.Message
+				if err := json.Unmarshal(payload, &message); err != nil {
+					continue
+				}
+				hub.record(message)
+			}
+		}),
+	)
+
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+}
+
+func TestGRPCClientReconnectBackoffAndOrdering(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath, certPEM := generateTestCertificate(t, dir)
+	trustTestCertificate(t, dir, certPEM)
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("failed to load test certificate: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	hub := &testCloudHub{}
+	serveTestCloudHubOverGRPC(t, hub, &tls.Config{Certificates: []tls.Certificate{cert}}, listener)
+
+	conf := &config.Config{}
+	conf.WSConfig.Url = listener.Addr().String()
+	conf.WSConfig.CertFilePath = certPath
+	conf.WSConfig.KeyFilePath = keyPath
+
+	runMatrixOne(t, NewGRPCClient(conf))
+}
@@ -0,0 +1,164 @@
+package clients
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kubeedge/kubeedge/beehive/pkg/core/model"
+)
+
+// testCertPEM and testKeyPEM cache the pair generateTestCertificate
+// creates on its first call, so every test in the binary gets the same
+// certificate.
+var testCertPEM, testKeyPEM []byte
+
+// generateTestCertificate writes a self-signed certificate/key pair for
+// 127.0.0.1, valid for the lifetime of the test, to dir. The pair is
+// generated on the first call and reused by every later one. It returns
+// the cert/key paths (for config.WSConfig, which every transport loads
+// its client certificate from) and the certificate's PEM encoding (for
+// trustTestCertificate).
+func generateTestCertificate(t *testing.T, dir string) (certPath, keyPath string, certPEM []byte) {
+	t.Helper()
+
+	if testCertPEM != nil {
+		certPath, keyPath = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+		if os.WriteFile(certPath, testCertPEM, 0600) != nil || os.WriteFile(keyPath, testKeyPEM, 0600) != nil {
+			t.Fatalf("failed to write test certificate/key to %s", dir)
+		}
+		return certPath, keyPath, testCertPEM
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create test certificate: %v", err)
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal test key: %v", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	testCertPEM, testKeyPEM = certPEM, keyPEM
+
+	certPath = filepath.Join(dir, "cert.pem")
+	keyPath = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certPath, certPEM, 0600); err != nil {
+		t.Fatalf("failed to write test certificate: %v", err)
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		t.Fatalf("failed to write test key: %v", err)
+	}
+
+	return certPath, keyPath, certPEM
+}
+
+// trustTestCertificate makes certPEM a trusted root for the rest of the
+// test. None of the Adapters set tls.Config.RootCAs, so each one
+// verifies the server it dials against the process's default cert pool;
+// pointing SSL_CERT_FILE at our self-signed test certificate is what
+// lets the genuine client TLS handshake succeed against the local test
+// server below, the same way it would against a properly CA-signed
+// cloudhub certificate. The default pool is read only once per process,
+// on the first handshake, which is why generateTestCertificate hands
+// every test the same certificate.
+func trustTestCertificate(t *testing.T, dir string, certPEM []byte) {
+	t.Helper()
+
+	bundlePath := filepath.Join(dir, "ca-bundle.pem")
+	if err := os.WriteFile(bundlePath, certPEM, 0600); err != nil {
+		t.Fatalf("failed to write test CA bundle: %v", err)
+	}
+
+	previous, hadPrevious := os.LookupEnv("SSL_CERT_FILE")
+	os.Setenv("SSL_CERT_FILE", bundlePath)
+	t.Cleanup(func() {
+		if hadPrevious {
+			os.Setenv("SSL_CERT_FILE", previous)
+		} else {
+			os.Unsetenv("SSL_CERT_FILE")
+		}
+	})
+}
+
+// testCloudHub is a minimal stand-in for cloudhub, shared by the
+// per-transport matrix tests: every message a client sends is appended
+// to an ordered backlog, and whoever accepts the next connection
+// replays that backlog from wherever it left off. That's enough to let
+// runMatrixOne's reconnect/backoff/ordering assertions run against the
+// genuine client code and a real (loopback) network instead of a fake
+// Adapter standing in for the whole transport.
+type testCloudHub struct {
+	mu      sync.Mutex
+	backlog []model.Message
+}
+
+func (h *testCloudHub) record(message model.Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.backlog = append(h.backlog, message)
+}
+
+func (h *testCloudHub) snapshot() []model.Message {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]model.Message, len(h.backlog))
+	copy(out, h.backlog)
+	return out
+}
+
+// streamBacklog writes every entry hub has recorded to write, oldest
+// first, and keeps polling for new ones until write errors (the
+// connection closed) or stop is closed. Polling instead of a one-shot
+// snapshot matters across a reconnect: the messages a prior connection
+// just sent may still be landing in hub.record() from that connection's
+// own read loop when this, the next connection's, write loop starts.
+func streamBacklog(hub *testCloudHub, stop <-chan struct{}, write func(model.Message) error) {
+	sent := 0
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		backlog := hub.snapshot()
+		for ; sent < len(backlog); sent++ {
+			if err := write(backlog[sent]); err != nil {
+				return
+			}
+		}
+	}
+}
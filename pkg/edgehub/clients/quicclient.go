@@ -0,0 +1,101 @@
+package clients
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"sync"
+
+	"github.com/lucas-clemente/quic-go"
+
+	"github.com/kubeedge/kubeedge/beehive/pkg/common/log"
+	"github.com/kubeedge/kubeedge/beehive/pkg/core/model"
+	"github.com/kubeedge/kubeedge/pkg/edgehub/config"
+)
+
+// QUICClient is an Adapter backed by a single QUIC stream, newline
+// delimited JSON frames of model.Message. QUIC gives edgehub 0-RTT
+// reconnects after a network blip, which matters more on the lossy links
+// edge nodes tend to sit behind than it does for the cloudhub side.
+type QUICClient struct {
+	config  *config.Config
+	session quic.Session
+	stream  quic.Stream
+	reader  *bufio.Reader
+	sendMu  sync.Mutex
+}
+
+func NewQUICClient(conf *config.Config) *QUICClient {
+	return &QUICClient{config: conf}
+}
+
+func (c *QUICClient) Init() error {
+	cert, err := tls.LoadX509KeyPair(c.config.WSConfig.CertFilePath, c.config.WSConfig.KeyFilePath)
+	if err != nil {
+		log.LOGGER.Errorf("failed to load x509 key pair: %v", err)
+		return err
+	}
+
+	tlsConf := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"kubeedge-edgehub"},
+	}
+
+	session, err := quic.DialAddr(c.config.WSConfig.Url, tlsConf, nil)
+	if err != nil {
+		log.LOGGER.Errorf("failed to dial cloud hub over quic: %v", err)
+		return err
+	}
+
+	stream, err := session.OpenStreamSync(context.Background())
+	if err != nil {
+		session.Close()
+		log.LOGGER.Errorf("failed to open quic stream: %v", err)
+		return err
+	}
+
+	c.session = session
+	c.stream = stream
+	c.reader = bufio.NewReader(stream)
+	return nil
+}
+
+func (c *QUICClient) Uninit() {
+	if c.stream != nil {
+		if err := c.stream.Close(); err != nil {
+			log.LOGGER.Errorf("failed to close quic stream: %v", err)
+		}
+	}
+	if c.session != nil {
+		if err := c.session.Close(); err != nil {
+			log.LOGGER.Errorf("failed to close quic session: %v", err)
+		}
+	}
+}
+
+func (c *QUICClient) Send(message model.Message) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	payload = append(payload, '\n')
+
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	_, err = c.stream.Write(payload)
+	return err
+}
+
+func (c *QUICClient) Receive() (model.Message, error) {
+	var message model.Message
+	line, err := c.reader.ReadBytes('\n')
+	if err != nil {
+		return message, err
+	}
+
+	if err := json.Unmarshal(line, &message); err != nil {
+		return message, err
+	}
+	return message, nil
+}
@@ -0,0 +1,95 @@
+package clients
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"testing"
+
+	"github.com/lucas-clemente/quic-go"
+
+	"github.com/kubeedge/kubeedge/beehive/pkg/core/model"
+	"github.com/kubeedge/kubeedge/pkg/edgehub/config"
+)
+
+// serveTestCloudHubOverQUIC starts a quic listener on addr that accepts
+// one stream per session, recording every inbound message into hub and
+// replaying hub's backlog back to the client via streamBacklog, using
+// the same newline-delimited JSON framing QUICClient speaks.
+func serveTestCloudHubOverQUIC(t *testing.T, hub *testCloudHub, tlsConfig *tls.Config, addr string) string {
+	t.Helper()
+
+	tlsConfig.NextProtos = []string{"kubeedge-edgehub"}
+	listener, err := quic.ListenAddr(addr, tlsConfig, nil)
+	if err != nil {
+		t.Fatalf("failed to listen over quic: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			session, err := listener.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			go handleTestQUICSession(hub, session)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func handleTestQUICSession(hub *testCloudHub, session quic.Session) {
+	stream, err := session.AcceptStream(context.Background())
+	if err != nil {
+		return
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go streamBacklog(hub, stop, func(message model.Message) error {
+		payload, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		payload = append(payload, '\n')
+		_, err = stream.Write(payload)
+		return err
+	})
+
+	reader := bufio.NewReader(stream)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+
+		var message model.Message
+		if err := json.Unmarshal(line, &message); err != nil {
+			continue
+		}
+		hub.record(message)
+	}
+}
+
+func TestQUICClientReconnectBackoffAndOrdering(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath, certPEM := generateTestCertificate(t, dir)
+	trustTestCertificate(t, dir, certPEM)
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("failed to load test certificate: %v", err)
+	}
+
+	hub := &testCloudHub{}
+	addr := serveTestCloudHubOverQUIC(t, hub, &tls.Config{Certificates: []tls.Certificate{cert}}, "127.0.0.1:0")
+
+	conf := &config.Config{}
+	conf.WSConfig.Url = addr
+	conf.WSConfig.CertFilePath = certPath
+	conf.WSConfig.KeyFilePath = keyPath
+
+	runMatrixOne(t, NewQUICClient(conf))
+}
@@ -0,0 +1,67 @@
+package clients
+
+import (
+	"crypto/tls"
+	"sync"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/kubeedge/kubeedge/beehive/pkg/common/log"
+	"github.com/kubeedge/kubeedge/beehive/pkg/core/model"
+	"github.com/kubeedge/kubeedge/pkg/edgehub/config"
+)
+
+// WebSocketClient is the original Adapter implementation: a single
+// long-lived websocket connection, authenticated with the same cert/key
+// pair used against the placement service.
+type WebSocketClient struct {
+	config *config.Config
+	conn   *websocket.Conn
+	sendMu sync.Mutex
+}
+
+func NewWebSocketClient(conf *config.Config) *WebSocketClient {
+	return &WebSocketClient{config: conf}
+}
+
+func (c *WebSocketClient) Init() error {
+	cert, err := tls.LoadX509KeyPair(c.config.WSConfig.CertFilePath, c.config.WSConfig.KeyFilePath)
+	if err != nil {
+		log.LOGGER.Errorf("failed to load x509 key pair: %v", err)
+		return err
+	}
+
+	dialer := websocket.Dialer{
+		TLSClientConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+	}
+
+	conn, _, err := dialer.Dial(c.config.WSConfig.Url, nil)
+	if err != nil {
+		log.LOGGER.Errorf("failed to dial cloud hub over websocket: %v", err)
+		return err
+	}
+
+	c.conn = conn
+	return nil
+}
+
+func (c *WebSocketClient) Uninit() {
+	if c.conn == nil {
+		return
+	}
+	if err := c.conn.Close(); err != nil {
+		log.LOGGER.Errorf("failed to close websocket connection: %v", err)
+	}
+}
+
+func (c *WebSocketClient) Send(message model.Message) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	return c.conn.WriteJSON(message)
+}
+
+func (c *WebSocketClient) Receive() (model.Message, error) {
+	var message model.Message
+	err := c.conn.ReadJSON(&message)
+	return message, err
+}
@@ -0,0 +1,78 @@
+package clients
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/kubeedge/kubeedge/beehive/pkg/core/model"
+	"github.com/kubeedge/kubeedge/pkg/edgehub/config"
+)
+
+var testUpgrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+
+// serveTestCloudHubOverWebSocket starts a TLS websocket server on
+// listener that records every inbound message into hub and, on each
+// accepted connection, replays hub's backlog back to the client via
+// streamBacklog.
+func serveTestCloudHubOverWebSocket(t *testing.T, hub *testCloudHub, tlsConfig *tls.Config, listener net.Listener) {
+	t.Helper()
+
+	server := &http.Server{
+		TLSConfig: tlsConfig,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, err := testUpgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			stop := make(chan struct{})
+			defer close(stop)
+			go streamBacklog(hub, stop, func(message model.Message) error {
+				return conn.WriteJSON(message)
+			})
+
+			for {
+				var message model.Message
+				if err := conn.ReadJSON(&message); err != nil {
+					return
+				}
+				hub.record(message)
+			}
+		}),
+	}
+
+	go server.ServeTLS(listener, "", "")
+	t.Cleanup(func() { server.Close() })
+}
+
+func TestWebSocketClientReconnectBackoffAndOrdering(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath, certPEM := generateTestCertificate(t, dir)
+	trustTestCertificate(t, dir, certPEM)
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("failed to load test certificate: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	hub := &testCloudHub{}
+	serveTestCloudHubOverWebSocket(t, hub, &tls.Config{Certificates: []tls.Certificate{cert}}, listener)
+
+	conf := &config.Config{}
+	conf.WSConfig.Url = "wss://" + listener.Addr().String()
+	conf.WSConfig.CertFilePath = certPath
+	conf.WSConfig.KeyFilePath = keyPath
+
+	runMatrixOne(t, NewWebSocketClient(conf))
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"sync"
+	"time"
+)
+
+// ControllerConfig holds the settings that drive EdgeHubController: which
+// cloudhub it talks to, how it authenticates with the placement service,
+// and the timings it uses once connected.
+type ControllerConfig struct {
+	ProjectID       string
+	NodeId          string
+	PlacementUrl    string
+	HeartbeatPeroid time.Duration
+
+	// Protocol selects the transport EdgeHubController dials cloudhub
+	// with. Defaults to clients.ClientTypeWebSocket when empty.
+	Protocol string
+
+	// DataDir is the edge node's local state directory; the offline
+	// queue's on-disk file is kept at DataDir/edgehub-offline-queue.db.
+	DataDir string
+
+	// OfflineQueueSize bounds how many messages the offline queue holds
+	// before it starts dropping the oldest entry to make room. Defaults
+	// to defaultOfflineQueueSize when zero.
+	OfflineQueueSize int
+
+	// OfflineQueueMessageTTL is how long a queued message is kept before
+	// it's dropped as stale on replay. Defaults to
+	// defaultOfflineQueueMessageTTL when zero.
+	OfflineQueueMessageTTL time.Duration
+
+	// ConvertSyncOnDisconnect controls what happens to a sync message
+	// sent while disconnected from cloudhub: if true it's queued as a
+	// plain async message (the caller's wait for a response is abandoned
+	// immediately), if false it fails fast instead of being queued.
+	ConvertSyncOnDisconnect bool
+
+	// SyncResponseTimeout bounds how long sendToCloud waits for a sync
+	// message's response before giving up, independent of
+	// HeartbeatPeroid. Defaults to defaultSyncResponseTimeout when zero.
+	SyncResponseTimeout time.Duration
+
+	// SyncTrackerMaxPending bounds how many sync requests may be
+	// awaiting a response at once, so a cloudhub that stops answering
+	// can't grow the pending set without limit. Defaults to
+	// defaultSyncTrackerMaxPending when zero.
+	SyncTrackerMaxPending int
+}
+
+// WebSocketConfig holds the connection details shared by every transport:
+// the cloudhub URL resolved via the placement service and the mTLS
+// material used to authenticate against it.
+type WebSocketConfig struct {
+	Url          string
+	CertFilePath string
+	KeyFilePath  string
+}
+
+type Config struct {
+	CtrConfig ControllerConfig
+	WSConfig  WebSocketConfig
+}
+
+var (
+	config     *Config
+	configOnce sync.Once
+)
+
+// GetConfig returns the process-wide edgehub configuration, lazily
+// initialized from defaults on first use.
+func GetConfig() *Config {
+	configOnce.Do(func() {
+		config = &Config{}
+	})
+	return config
+}
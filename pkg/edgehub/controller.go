@@ -1,6 +1,7 @@
 package edgehub
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -9,17 +10,40 @@ import (
 
 	"github.com/kubeedge/kubeedge/beehive/pkg/common/log"
 	"github.com/kubeedge/kubeedge/beehive/pkg/core"
-	"github.com/kubeedge/kubeedge/beehive/pkg/core/context"
+	beehiveContext "github.com/kubeedge/kubeedge/beehive/pkg/core/context"
 	"github.com/kubeedge/kubeedge/beehive/pkg/core/model"
 
 	"github.com/kubeedge/kubeedge/pkg/common/message"
 	"github.com/kubeedge/kubeedge/pkg/edgehub/clients"
 	http_utils "github.com/kubeedge/kubeedge/pkg/edgehub/common/http"
 	"github.com/kubeedge/kubeedge/pkg/edgehub/config"
+	"github.com/kubeedge/kubeedge/pkg/edgehub/faultinjector"
 )
 
 const (
 	waitConnectionPeriod = time.Minute
+
+	// defaultShutdownGracePeriod bounds how long Shutdown waits for
+	// outstanding sync responses to drain from the sync tracker before it
+	// gives up and closes the connection anyway.
+	defaultShutdownGracePeriod = 10 * time.Second
+
+	// defaultSyncResponseTimeout is how long sendToCloud waits for a sync
+	// message's response when config.SyncResponseTimeout is unset.
+	defaultSyncResponseTimeout = 30 * time.Second
+
+	// defaultSyncTrackerMaxPending bounds the syncTracker's pending set
+	// when config.SyncTrackerMaxPending is unset.
+	defaultSyncTrackerMaxPending = 1000
+
+	// faultInjectorAdminAddr is where the fault-injection admin endpoint
+	// listens when the binary is built with -tags faultinjector. It's
+	// loopback-only by design: this is a CI/staging knob, not something
+	// reachable off the node.
+	faultInjectorAdminAddr = "127.0.0.1:8384"
+
+	// metricsAddr is where the Prometheus /metrics endpoint is exposed.
+	metricsAddr = "0.0.0.0:9100"
 )
 
 var (
@@ -27,29 +51,48 @@ var (
 	groupMap      = map[string]string{"resource": core.MetaGroup,
 		"twin": core.TwinGroup, "app": "sync",
 		"func": core.MetaGroup, "user": core.BusGroup}
-
-	// clear the number of data of the stop channel
-	times = 2
 )
 
 type EdgeHubController struct {
-	context    *context.Context
-	chClient   clients.Adapter
-	config     *config.ControllerConfig
-	stopChan   chan struct{}
-	syncKeeper map[string]chan model.Message
-	keeperLock sync.RWMutex
+	context      *beehiveContext.Context
+	chClient     clients.Adapter
+	config       *config.ControllerConfig
+	offlineQueue *offlineQueue
+	syncTracker  *syncTracker
+
+	faultAdminStarted    bool
+	metricsServerStarted bool
+
+	// runCtx is cancelled to unwind routeToEdge, routeToCloud and
+	// keepalive in place of the old stopChan fan-in; runCancel triggers
+	// it and shutdownDone is closed once Start has torn everything down.
+	runCtx       context.Context
+	runCancel    context.CancelFunc
+	shutdownDone chan struct{}
 }
 
 func NewEdgeHubController() *EdgeHubController {
+	ctrConfig := &config.GetConfig().CtrConfig
 	return &EdgeHubController{
-		config:     &config.GetConfig().CtrConfig,
-		stopChan:   make(chan struct{}),
-		syncKeeper: make(map[string]chan model.Message),
+		config:       ctrConfig,
+		syncTracker:  newSyncTracker(ctrConfig.SyncTrackerMaxPending),
+		shutdownDone: make(chan struct{}),
 	}
 }
 
-func (ehc *EdgeHubController) initial(ctx *context.Context) error {
+func (ehc *EdgeHubController) initial(ctx *beehiveContext.Context) error {
+	if faultinjector.Enabled() && !ehc.faultAdminStarted {
+		if err := faultinjector.StartAdminServer(faultInjectorAdminAddr); err != nil {
+			log.LOGGER.Errorf("failed to start fault injection admin server: %v", err)
+		}
+		ehc.faultAdminStarted = true
+	}
+
+	if !ehc.metricsServerStarted {
+		startMetricsServer(metricsAddr)
+		ehc.metricsServerStarted = true
+	}
+
 	getUrl := func() string {
 		for {
 			url, err := ehc.getCloudHubUrl()
@@ -70,10 +113,24 @@ func (ehc *EdgeHubController) initial(ctx *context.Context) error {
 		log.LOGGER.Warnf("use the config url for testing")
 	}
 
-	cloudHubClient := clients.GetClient(clients.ClientTypeWebSocket, config.GetConfig())
+	protocol := clients.ClientType(ehc.config.Protocol)
+	if protocol == "" {
+		protocol = clients.ClientTypeWebSocket
+	}
+
+	cloudHubClient := clients.GetClient(protocol, config.GetConfig())
 	if cloudHubClient == nil {
-		log.LOGGER.Errorf("failed to get web socket client")
-		return fmt.Errorf("failed to get web socket client")
+		log.LOGGER.Errorf("failed to get client for transport protocol: %s", protocol)
+		return fmt.Errorf("failed to get client for transport protocol: %s", protocol)
+	}
+
+	if ehc.offlineQueue == nil {
+		queue, err := newOfflineQueue(ehc.config.DataDir, ehc.config.OfflineQueueSize, ehc.config.OfflineQueueMessageTTL)
+		if err != nil {
+			log.LOGGER.Errorf("failed to open offline queue: %v", err)
+			return fmt.Errorf("failed to open offline queue: %v", err)
+		}
+		ehc.offlineQueue = queue
 	}
 
 	ehc.context = ctx
@@ -82,8 +139,15 @@ func (ehc *EdgeHubController) initial(ctx *context.Context) error {
 	return nil
 }
 
-func (ehc *EdgeHubController) Start(ctx *context.Context) {
+func (ehc *EdgeHubController) Start(ctx *beehiveContext.Context) {
+	ehc.runCtx, ehc.runCancel = context.WithCancel(context.Background())
+
 	for {
+		if ehc.runCtx.Err() != nil {
+			close(ehc.shutdownDone)
+			return
+		}
+
 		err := ehc.initial(ctx)
 		if err != nil {
 			log.LOGGER.Fatalf("failed to init controller: %v", err)
@@ -97,79 +161,106 @@ func (ehc *EdgeHubController) Start(ctx *context.Context) {
 			continue
 		}
 
+		// drain anything queued while we were disconnected before telling
+		// the rest of the system we're back, so replayed messages reach
+		// cloudhub ahead of anything newly produced after reconnect
+		ehc.replayOfflineQueue()
+
 		// execute hook func after connect
 		ehc.pubConnectInfo(true)
 
-		go ehc.routeToEdge()
-		go ehc.routeToCloud()
-		go ehc.keepalive()
-
-		// wait the stop singal
-		// stop authinfo manager/websocket connection
-		<-ehc.stopChan
+		runCtx, disconnect := context.WithCancel(ehc.runCtx)
+
+		var wg sync.WaitGroup
+		wg.Add(3)
+		go func() { defer wg.Done(); ehc.routeToEdge(runCtx, disconnect) }()
+		go func() { defer wg.Done(); ehc.routeToCloud(runCtx, disconnect) }()
+		go func() { defer wg.Done(); ehc.keepalive(runCtx, disconnect) }()
+
+		// block until either routeToEdge/routeToCloud/keepalive hits an
+		// unrecoverable error (disconnect) or Shutdown was called
+		// (ehc.runCtx). Uninit the client as soon as that happens, before
+		// waiting on wg: routeToEdge/keepalive are typically blocked in
+		// chClient.Receive()/Send() at this point, and closing the
+		// connection out from under them is what makes those calls return
+		// an error so the goroutines actually exit. Waiting until after
+		// wg.Wait() to Uninit would deadlock on an otherwise idle
+		// connection.
+		<-runCtx.Done()
 		ehc.chClient.Uninit()
+		wg.Wait()
 
 		// execute hook fun after disconnect
 		ehc.pubConnectInfo(false)
 
+		if ehc.runCtx.Err() != nil {
+			close(ehc.shutdownDone)
+			return
+		}
+
 		// sleep one period of heartbeat, then try to connect cloud hub again
 		time.Sleep(ehc.config.HeartbeatPeroid * 2)
-
-		// clean channel
-		for i := 0; i < times; i++ {
-			select {
-			case <-ehc.stopChan:
-				continue
-			default:
-			}
-		}
 	}
 }
 
-func (ehc *EdgeHubController) addKeepChannel(msgID string) chan model.Message {
-	ehc.keeperLock.Lock()
-	defer ehc.keeperLock.Unlock()
-
-	tempChannel := make(chan model.Message)
-	ehc.syncKeeper[msgID] = tempChannel
-
-	return tempChannel
-}
+// Shutdown cancels runCtx, which stops routeToCloud taking new outbound
+// messages, ends every pending sync wait at once (their responses are
+// not awaited) and makes Start tear down the cloudhub connection and
+// announce the node is going away. It then waits up to the grace period
+// for the sync tracker's pending set to empty, and blocks until Start has
+// returned or ctx is cancelled/expires, whichever comes first.
+func (ehc *EdgeHubController) Shutdown(ctx context.Context) error {
+	if ehc.runCancel == nil {
+		return fmt.Errorf("edgehub controller was never started")
+	}
 
-func (ehc *EdgeHubController) deleteKeepChannel(msgID string) {
-	ehc.keeperLock.Lock()
-	defer ehc.keeperLock.Unlock()
+	gracePeriod := defaultShutdownGracePeriod
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); remaining < gracePeriod {
+			gracePeriod = remaining
+		}
+	}
 
-	delete(ehc.syncKeeper, msgID)
-}
+	// stop accepting new outbound messages from beehive; this also ends
+	// the in-flight sync waits, whose contexts derive from runCtx
+	ehc.runCancel()
 
-func (ehc *EdgeHubController) isSyncResponse(msgID string) bool {
-	ehc.keeperLock.RLock()
-	defer ehc.keeperLock.RUnlock()
+	ehc.waitForSyncTrackerDrain(gracePeriod)
 
-	_, exist := ehc.syncKeeper[msgID]
-	return exist
+	// Start's own unwind (triggered by ehc.runCancel() above) already
+	// calls pubConnectInfo(false) once it tears the connection down; a
+	// second call here would publish a duplicate CLOUD_DISCONNECTED
+	// notification to every downstream group, so we just wait for it.
+	select {
+	case <-ehc.shutdownDone:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-func (ehc *EdgeHubController) sendToKeepChannel(message model.Message) error {
-	ehc.keeperLock.RLock()
-	defer ehc.keeperLock.RUnlock()
+// waitForSyncTrackerDrain blocks until the sync tracker has no pending
+// requests left or gracePeriod elapses, whichever comes first, polling
+// rather than hooking every Dispatch because draining is an exceptional,
+// shutdown-only path.
+func (ehc *EdgeHubController) waitForSyncTrackerDrain(gracePeriod time.Duration) {
+	deadline := time.After(gracePeriod)
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
 
-	channel, exist := ehc.syncKeeper[message.GetParentID()]
-	if !exist {
-		log.LOGGER.Errorf("failed to get sync keeper channel, messageID:%+v", message)
-		return fmt.Errorf("failed to get sync keeper channel, messageID:%+v", message)
-	}
+	for {
+		pending := ehc.syncTracker.PendingCount()
+		if pending == 0 {
+			return
+		}
 
-	// send response into synckeep channel
-	select {
-	case channel <- message:
-	default:
-		log.LOGGER.Errorf("failed to send message to sync keep channel")
-		return fmt.Errorf("failed to send message to sync keep channel")
+		select {
+		case <-deadline:
+			log.LOGGER.Warnf("shutdown grace period expired with %d sync request(s) still pending", pending)
+			return
+		case <-ticker.C:
+		}
 	}
-
-	return nil
 }
 
 func (ehc *EdgeHubController) dispatch(message model.Message) error {
@@ -177,99 +268,224 @@ func (ehc *EdgeHubController) dispatch(message model.Message) error {
 	// TODO: dispatch message by the message type
 	md, ok := groupMap[message.GetGroup()]
 	if !ok {
-		log.LOGGER.Warnf("msg_group not found")
+		log.LOGGER.Warnf("event=dispatch_failed reason=msg_group_not_found msg_id=%s group=%s", message.GetID(), message.GetGroup())
 		return fmt.Errorf("msg_group not found")
 	}
 
-	isResponse := ehc.isSyncResponse(message.GetParentID())
-	if !isResponse {
-		ehc.context.Send2Group(md, message)
+	if ehc.syncTracker.Dispatch(message.GetParentID(), message) {
 		return nil
 	}
 
-	return ehc.sendToKeepChannel(message)
+	ehc.context.Send2Group(md, message)
+	return nil
 }
 
-func (ehc *EdgeHubController) routeToEdge() {
+func (ehc *EdgeHubController) routeToEdge(ctx context.Context, disconnect context.CancelFunc) {
 	for {
+		if ctx.Err() != nil {
+			return
+		}
+
 		message, err := ehc.chClient.Receive()
 		if err != nil {
-			log.LOGGER.Errorf("websocket read error: %v", err)
-			ehc.stopChan <- struct{}{}
+			log.LOGGER.Errorf("event=websocket_read_error error=%q", err)
+			disconnect()
 			return
 		}
 
-		log.LOGGER.Infof("received msg from cloud-hub:%#v", message)
+		if faultinjector.ShouldDropInbound() {
+			log.LOGGER.Warnf("event=message_dropped reason=fault_injection msg_id=%s", message.GetID())
+			continue
+		}
+		faultinjector.CorruptPayload(&message)
+
+		messagesReceivedTotal.WithLabelValues(message.GetGroup(), message.GetOperation()).Inc()
+		log.LOGGER.Infof("event=message_received module=%s msg_id=%s parent_id=%s group=%s operation=%s",
+			ModuleNameEdgeHub, message.GetID(), message.GetParentID(), message.GetGroup(), message.GetOperation())
+
 		err = ehc.dispatch(message)
 		if err != nil {
-			log.LOGGER.Errorf("failed to dispatch message, discard: %v", err)
+			log.LOGGER.Errorf("event=dispatch_failed msg_id=%s error=%q", message.GetID(), err)
 		}
 	}
 }
 
-func (ehc *EdgeHubController) sendToCloud(message model.Message) error {
+func (ehc *EdgeHubController) sendToCloud(ctx context.Context, message model.Message) error {
+	if delay := faultinjector.SendDelay(); delay > 0 {
+		time.Sleep(delay)
+	}
+
+	if faultinjector.IsCloudPartitioned() {
+		// the message is lost without an error, so routeToCloud keeps
+		// running and the connection, and routeToEdge with it, stays up
+		log.LOGGER.Warnf("event=message_dropped reason=fault_injection_partition msg_id=%s", message.GetID())
+		return nil
+	}
+
 	err := ehc.chClient.Send(message)
 	if err != nil {
-		log.LOGGER.Errorf("failed to send message: %v", err)
+		log.LOGGER.Errorf("event=message_send_failed module=%s msg_id=%s group=%s operation=%s error=%q",
+			ModuleNameEdgeHub, message.GetID(), message.GetGroup(), message.GetOperation(), err)
+		ehc.enqueueOffline(message)
 		return fmt.Errorf("failed to send message, error: %v", err)
 	}
 
-	syncKeep := func(message model.Message) {
-		tempChannel := ehc.addKeepChannel(message.GetID())
-		sendTimer := time.NewTimer(ehc.config.HeartbeatPeroid)
-		select {
-		case response := <-tempChannel:
-			sendTimer.Stop()
-			ehc.context.SendResp(response)
-			ehc.deleteKeepChannel(response.GetParentID())
-		case <-sendTimer.C:
-			log.LOGGER.Warnf("timeout to receive response for message: %+v", message)
-			ehc.deleteKeepChannel(message.GetID())
-		}
-	}
+	messagesSentTotal.WithLabelValues(message.GetGroup(), message.GetOperation()).Inc()
 
 	if message.IsSync() {
-		go syncKeep(message)
+		go ehc.waitForResponse(ctx, message, time.Now())
 	}
 
 	return nil
 }
 
-func (ehc *EdgeHubController) routeToCloud() {
+// waitForResponse waits for the cloudhub response to message, bounded by
+// config.SyncResponseTimeout and by ctx (the connection's lifetime, so a
+// disconnect or Shutdown stops the wait immediately instead of leaking
+// until the timeout fires). sentAt feeds the send_sync_latency_seconds
+// histogram whether the wait succeeds, times out, or is abandoned.
+func (ehc *EdgeHubController) waitForResponse(ctx context.Context, message model.Message, sentAt time.Time) {
+	timeout := ehc.config.SyncResponseTimeout
+	if timeout <= 0 {
+		timeout = defaultSyncResponseTimeout
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	response, err := ehc.syncTracker.Wait(waitCtx, message.GetID())
+	sendSyncLatencySeconds.WithLabelValues(message.GetGroup()).Observe(time.Since(sentAt).Seconds())
+	if err != nil {
+		log.LOGGER.Warnf("event=sync_response_abandoned msg_id=%s group=%s error=%q", message.GetID(), message.GetGroup(), err)
+		return
+	}
+
+	ehc.context.SendResp(response)
+}
+
+// enqueueOffline persists message to the offline queue so it can be
+// replayed once cloudhub is reachable again. A sync message is only
+// queued when ConvertSyncOnDisconnect allows it, since its caller is
+// already gone by the time a reconnect happens; otherwise it's dropped.
+func (ehc *EdgeHubController) enqueueOffline(message model.Message) {
+	if message.IsSync() {
+		if !ehc.config.ConvertSyncOnDisconnect {
+			log.LOGGER.Warnf("dropping sync message %s, cloud unreachable and ConvertSyncOnDisconnect is disabled", message.GetID())
+			return
+		}
+		log.LOGGER.Warnf("cloud unreachable, queuing sync message %s for best-effort async delivery", message.GetID())
+	}
+
+	if err := ehc.offlineQueue.Enqueue(message); err != nil {
+		log.LOGGER.Errorf("failed to queue message %s for offline delivery: %v", message.GetID(), err)
+	}
+}
+
+// replayOfflineQueue flushes everything queued while disconnected, in
+// FIFO order, straight through chClient. It's called once per successful
+// reconnect, before routeToCloud resumes taking new messages from
+// beehive.
+func (ehc *EdgeHubController) replayOfflineQueue() {
+	if ehc.offlineQueue == nil {
+		return
+	}
+
+	if err := ehc.offlineQueue.Replay(ehc.chClient.Send); err != nil {
+		log.LOGGER.Warnf("offline queue replay stopped early, remaining messages stay queued: %v", err)
+	}
+}
+
+// edgeReceiveResult carries back the result of a single
+// ehc.context.Receive(ModuleNameEdgeHub) call, so routeToCloud can select
+// on it alongside ctx instead of blocking on it directly.
+type edgeReceiveResult struct {
+	message model.Message
+	err     error
+}
+
+func (ehc *EdgeHubController) routeToCloud(ctx context.Context, disconnect context.CancelFunc) {
 	for {
-		message, err := ehc.context.Receive(ModuleNameEdgeHub)
-		if err != nil {
-			log.LOGGER.Errorf("failed to receive message from edge: %v", err)
+		if ctx.Err() != nil {
+			return
+		}
+
+		// ehc.context.Receive blocks on beehive's internal mailbox and has
+		// no way to take a context, so it can't be made to return early on
+		// its own. Run it on a side goroutine and select on ctx.Done()
+		// instead, so a disconnect/Shutdown makes routeToCloud return
+		// promptly even with nothing queued for this module; the
+		// goroutine itself is left to exit whenever its Receive next
+		// unblocks.
+		received := make(chan edgeReceiveResult, 1)
+		go func() {
+			message, err := ehc.context.Receive(ModuleNameEdgeHub)
+			received <- edgeReceiveResult{message: message, err: err}
+		}()
+
+		var result edgeReceiveResult
+		select {
+		case <-ctx.Done():
+			return
+		case result = <-received:
+		}
+
+		if result.err != nil {
+			log.LOGGER.Errorf("failed to receive message from edge: %v", result.err)
 			time.Sleep(time.Second)
 			continue
 		}
 
 		// post message to cloud hub
-		err = ehc.sendToCloud(message)
-		if err != nil {
+		if err := ehc.sendToCloud(ctx, result.message); err != nil {
 			log.LOGGER.Errorf("failed to send message to cloud: %v", err)
-			ehc.stopChan <- struct{}{}
+			disconnect()
 			return
 		}
 	}
 }
 
-func (ehc *EdgeHubController) keepalive() {
+func (ehc *EdgeHubController) keepalive(ctx context.Context, disconnect context.CancelFunc) {
 	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
 		msg := model.NewMessage("").
 			BuildRouter(ModuleNameEdgeHub, "resource", "node", "keepalive").
 			FillBody("ping")
+		sentAt := time.Now()
 		err := ehc.chClient.Send(*msg)
 		if err != nil {
-			log.LOGGER.Errorf("websocket write error: %v", err)
-			ehc.stopChan <- struct{}{}
+			log.LOGGER.Errorf("event=keepalive_send_failed error=%q", err)
+			disconnect()
+			return
+		}
+		observeKeepaliveRTT(sentAt)
+		ehc.sampleQueueGauges()
+
+		if pending := ehc.syncTracker.PendingCount(); pending > 0 {
+			log.LOGGER.Infof("event=sync_requests_pending count=%d", pending)
+		}
+
+		if faultinjector.ShouldForceReconnect() {
+			log.LOGGER.Warnf("fault injection: forcing reconnect")
+			disconnect()
 			return
 		}
-		time.Sleep(ehc.config.HeartbeatPeroid)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(ehc.config.HeartbeatPeroid):
+		}
 	}
 }
 
 func (ehc *EdgeHubController) pubConnectInfo(isConnected bool) {
+	ehc.recordConnectionState(isConnected)
+
 	// var info model.Message
 	content := model.CLOUD_CONNECTED
 	if !isConnected {
@@ -0,0 +1,179 @@
+// +build faultinjector
+
+// Package faultinjector lets CI and staging deterministically reproduce
+// the edge-to-cloud failure modes that are otherwise only discoverable
+// in production: a dropped inbound message, a corrupted payload, a slow
+// cloudhub, a reconnect storm, or a partition where routeToEdge keeps
+// working while routeToCloud silently doesn't. It's only compiled in
+// with `-tags faultinjector`; see faultinjector_noop.go for the stub
+// that ships in normal builds.
+package faultinjector
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kubeedge/kubeedge/beehive/pkg/common/log"
+	"github.com/kubeedge/kubeedge/beehive/pkg/core/model"
+)
+
+// delayDistribution describes the random delay, in milliseconds, applied
+// before a send when the delay-send fault is armed.
+type delayDistribution struct {
+	MinMillis int `json:"minMillis"`
+	MaxMillis int `json:"maxMillis"`
+}
+
+type state struct {
+	mu sync.RWMutex
+
+	dropInbound       bool
+	corruptPayload    bool
+	reconnectStorm    bool
+	partitionCloud    bool
+	delaySend         bool
+	delayDistribution delayDistribution
+}
+
+var s = &state{
+	delayDistribution: delayDistribution{MinMillis: 100, MaxMillis: 500},
+}
+
+// Enabled reports whether this binary was built with fault injection
+// compiled in.
+func Enabled() bool { return true }
+
+// ShouldDropInbound reports whether a message arriving from cloudhub
+// should be silently discarded before dispatch.
+func ShouldDropInbound() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.dropInbound
+}
+
+// CorruptPayload mutates message's content in place when the
+// corrupt-payload fault is armed, simulating bit-level corruption on the
+// wire.
+func CorruptPayload(message *model.Message) {
+	s.mu.RLock()
+	armed := s.corruptPayload
+	s.mu.RUnlock()
+	if !armed {
+		return
+	}
+	message.FillBody("\x00corrupted\x00")
+}
+
+// SendDelay returns how long the caller should sleep before a send, or
+// zero if the delay-send fault isn't armed.
+func SendDelay() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.delaySend {
+		return 0
+	}
+
+	spread := s.delayDistribution.MaxMillis - s.delayDistribution.MinMillis
+	millis := s.delayDistribution.MinMillis
+	if spread > 0 {
+		millis += rand.Intn(spread)
+	}
+	return time.Duration(millis) * time.Millisecond
+}
+
+// ShouldForceReconnect reports whether the caller should tear down its
+// connection and reconnect immediately, simulating a reconnect storm.
+func ShouldForceReconnect() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.reconnectStorm
+}
+
+// IsCloudPartitioned reports whether outbound sends to cloudhub should
+// be made to fail while inbound traffic keeps flowing normally.
+func IsCloudPartitioned() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.partitionCloud
+}
+
+// StartAdminServer starts the fault-injection admin HTTP server bound to
+// addr, which must be a loopback address (e.g. "127.0.0.1:8384") - the
+// whole point of this package is to let CI arm faults, not to expose a
+// remote kill switch.
+func StartAdminServer(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/faults/drop-inbound", armHandler(&s.dropInbound))
+	mux.HandleFunc("/faults/corrupt-payload", armHandler(&s.corruptPayload))
+	mux.HandleFunc("/faults/reconnect-storm", armHandler(&s.reconnectStorm))
+	mux.HandleFunc("/faults/partition-cloud", armHandler(&s.partitionCloud))
+	mux.HandleFunc("/faults/delay-send", delaySendHandler)
+	mux.HandleFunc("/faults/status", statusHandler)
+
+	server := &http.Server{Addr: addr, Handler: mux}
+	log.LOGGER.Warnf("fault injection admin endpoint listening on %s", addr)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.LOGGER.Errorf("fault injection admin server stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// armHandler returns a handler that arms target on POST /path?arm=true
+// and disarms it on POST /path?arm=false.
+func armHandler(target *bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		arm := r.URL.Query().Get("arm") != "false"
+		s.mu.Lock()
+		*target = arm
+		s.mu.Unlock()
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func delaySendHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	arm := r.URL.Query().Get("arm") != "false"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delaySend = arm
+
+	if arm {
+		var dist delayDistribution
+		if err := json.NewDecoder(r.Body).Decode(&dist); err == nil && dist.MaxMillis > 0 {
+			s.delayDistribution = dist
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"dropInbound":       s.dropInbound,
+		"corruptPayload":    s.corruptPayload,
+		"reconnectStorm":    s.reconnectStorm,
+		"partitionCloud":    s.partitionCloud,
+		"delaySend":         s.delaySend,
+		"delayDistribution": s.delayDistribution,
+	})
+}
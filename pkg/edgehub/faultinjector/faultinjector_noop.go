@@ -0,0 +1,26 @@
+// +build !faultinjector
+
+// This file provides the stub implementation of the faultinjector API
+// used in every normal build; see faultinjector.go for the real thing,
+// compiled in only with `-tags faultinjector`.
+package faultinjector
+
+import (
+	"time"
+
+	"github.com/kubeedge/kubeedge/beehive/pkg/core/model"
+)
+
+func Enabled() bool { return false }
+
+func ShouldDropInbound() bool { return false }
+
+func CorruptPayload(message *model.Message) {}
+
+func SendDelay() time.Duration { return 0 }
+
+func ShouldForceReconnect() bool { return false }
+
+func IsCloudPartitioned() bool { return false }
+
+func StartAdminServer(addr string) error { return nil }
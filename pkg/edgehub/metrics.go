@@ -0,0 +1,114 @@
+package edgehub
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/kubeedge/kubeedge/beehive/pkg/common/log"
+)
+
+var (
+	messagesSentTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kubeedge",
+		Subsystem: "edgehub",
+		Name:      "messages_sent_total",
+		Help:      "Number of messages edgehub has sent to cloudhub, by group and operation.",
+	}, []string{"group", "operation"})
+
+	messagesReceivedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kubeedge",
+		Subsystem: "edgehub",
+		Name:      "messages_received_total",
+		Help:      "Number of messages edgehub has received from cloudhub, by group and operation.",
+	}, []string{"group", "operation"})
+
+	sendSyncLatencySeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "kubeedge",
+		Subsystem: "edgehub",
+		Name:      "send_sync_latency_seconds",
+		Help:      "Time from sending a sync message until its response arrives (or the wait is abandoned), by group.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"group"})
+
+	keepaliveRTTSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "kubeedge",
+		Subsystem: "edgehub",
+		Name:      "keepalive_rtt_seconds",
+		Help:      "Time taken to send the keepalive ping to cloudhub; no reply is awaited, so this is not a round trip.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	connectionState = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "kubeedge",
+		Subsystem: "edgehub",
+		Name:      "connection_state",
+		Help:      "Whether edgehub is currently connected to cloudhub (1) or not (0).",
+	})
+
+	syncPendingGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "kubeedge",
+		Subsystem: "edgehub",
+		Name:      "sync_tracker_pending",
+		Help:      "Number of sync messages currently awaiting a cloudhub response.",
+	})
+
+	offlineQueueDepthGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "kubeedge",
+		Subsystem: "edgehub",
+		Name:      "offline_queue_depth",
+		Help:      "Number of messages currently buffered in the offline queue.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		messagesSentTotal,
+		messagesReceivedTotal,
+		sendSyncLatencySeconds,
+		keepaliveRTTSeconds,
+		connectionState,
+		syncPendingGauge,
+		offlineQueueDepthGauge,
+	)
+}
+
+// startMetricsServer exposes the collectors above on addr/metrics. It's
+// started once, the first time a controller initializes, same as the
+// fault injection admin server.
+func startMetricsServer(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	log.LOGGER.Infof("event=metrics_server_start addr=%s", addr)
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.LOGGER.Errorf("event=metrics_server_stop addr=%s error=%q", addr, err)
+		}
+	}()
+}
+
+// recordConnectionState updates the connection_state gauge and refreshes
+// the syncTracker/offlineQueue gauges, since a connect/disconnect
+// transition is a natural point to sample both.
+func (ehc *EdgeHubController) recordConnectionState(isConnected bool) {
+	if isConnected {
+		connectionState.Set(1)
+	} else {
+		connectionState.Set(0)
+	}
+	ehc.sampleQueueGauges()
+}
+
+func (ehc *EdgeHubController) sampleQueueGauges() {
+	syncPendingGauge.Set(float64(ehc.syncTracker.PendingCount()))
+	if ehc.offlineQueue != nil {
+		offlineQueueDepthGauge.Set(float64(ehc.offlineQueue.Depth()))
+	}
+}
+
+func observeKeepaliveRTT(start time.Time) {
+	keepaliveRTTSeconds.Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,270 @@
+package edgehub
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/kubeedge/kubeedge/beehive/pkg/common/log"
+	"github.com/kubeedge/kubeedge/beehive/pkg/core/model"
+)
+
+const (
+	offlineQueueFileName = "edgehub-offline-queue.db"
+
+	defaultOfflineQueueSize       = 10000
+	defaultOfflineQueueMessageTTL = 24 * time.Hour
+)
+
+var (
+	messagesBucket = []byte("messages")
+	msgIDIndex     = []byte("messages_by_id")
+)
+
+// queuedMessage is what actually gets persisted: the message plus the
+// time it was enqueued, so Replay can drop anything that's aged past its
+// TTL before it ever reaches cloudhub.
+type queuedMessage struct {
+	Message    model.Message
+	EnqueuedAt time.Time
+}
+
+// offlineQueue is a FIFO, on-disk store-and-forward buffer for messages
+// that routeToCloud can't deliver while disconnected from cloudhub. It's
+// backed by a single boltdb file so queued messages survive an edged
+// restart, not just a reconnect.
+type offlineQueue struct {
+	db      *bolt.DB
+	maxSize int
+	ttl     time.Duration
+
+	// size is a running count of messages currently queued, kept in sync
+	// with messagesBucket on every insert/removal so Depth and the
+	// maxSize check in Enqueue don't have to walk the whole bucket via
+	// Stats() on every call - Depth is sampled on each keepalive tick and
+	// the maxSize check runs on every Enqueue, so that walk would turn
+	// routine queueing into an O(n) bolt scan.
+	size int64
+}
+
+// newOfflineQueue opens (creating if needed) the offline queue database
+// under dataDir. maxSize <= 0 and ttl <= 0 fall back to their defaults.
+func newOfflineQueue(dataDir string, maxSize int, ttl time.Duration) (*offlineQueue, error) {
+	if maxSize <= 0 {
+		maxSize = defaultOfflineQueueSize
+	}
+	if ttl <= 0 {
+		ttl = defaultOfflineQueueMessageTTL
+	}
+
+	db, err := bolt.Open(filepath.Join(dataDir, offlineQueueFileName), 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	var initialSize int
+	err = db.Update(func(tx *bolt.Tx) error {
+		messages, err := tx.CreateBucketIfNotExists(messagesBucket)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(msgIDIndex); err != nil {
+			return err
+		}
+		initialSize = messages.Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &offlineQueue{db: db, maxSize: maxSize, ttl: ttl, size: int64(initialSize)}, nil
+}
+
+// Enqueue persists message for later replay. Re-enqueuing a message ID
+// that's already queued (a retry after another failed send) overwrites
+// the existing entry in place instead of appending a duplicate. Once the
+// queue holds more than maxSize entries, the oldest one is dropped to
+// make room.
+func (q *offlineQueue) Enqueue(message model.Message) error {
+	record := queuedMessage{Message: message, EnqueuedAt: time.Now()}
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	var inserted bool
+	var dropped int
+	err = q.db.Update(func(tx *bolt.Tx) error {
+		messages := tx.Bucket(messagesBucket)
+		index := tx.Bucket(msgIDIndex)
+
+		if existingKey := index.Get([]byte(message.GetID())); existingKey != nil {
+			return messages.Put(existingKey, payload)
+		}
+
+		seq, err := messages.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := seqKey(seq)
+
+		if err := messages.Put(key, payload); err != nil {
+			return err
+		}
+		if err := index.Put([]byte(message.GetID()), key); err != nil {
+			return err
+		}
+		inserted = true
+
+		sizeAfterInsert := int(atomic.LoadInt64(&q.size)) + 1
+		dropped, err = dropOldest(messages, index, sizeAfterInsert, q.maxSize)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if inserted {
+		atomic.AddInt64(&q.size, 1)
+	}
+	if dropped > 0 {
+		atomic.AddInt64(&q.size, -int64(dropped))
+	}
+	return nil
+}
+
+// Depth returns the number of messages currently queued.
+func (q *offlineQueue) Depth() int {
+	return int(atomic.LoadInt64(&q.size))
+}
+
+// errOfflineQueueDrained is returned internally by Replay's per-entry
+// transaction to signal "nothing left to replay"; it never escapes
+// Replay itself.
+var errOfflineQueueDrained = errors.New("offline queue drained")
+
+// Replay delivers every queued message, oldest first, via send. Entries
+// older than the queue's TTL are dropped rather than sent. Replay stops
+// at the first send error and leaves the remaining messages (including
+// the one that failed) queued for the next reconnect; anything already
+// delivered and removed before that point stays delivered - each entry
+// is read, sent and removed in its own transaction, so a later failure
+// can't roll back an earlier success.
+func (q *offlineQueue) Replay(send func(model.Message) error) error {
+	for {
+		var removed bool
+
+		err := q.db.Update(func(tx *bolt.Tx) error {
+			messages := tx.Bucket(messagesBucket)
+			index := tx.Bucket(msgIDIndex)
+			cursor := messages.Cursor()
+
+			key, payload := cursor.First()
+			if key == nil {
+				return errOfflineQueueDrained
+			}
+
+			var record queuedMessage
+			if err := json.Unmarshal(payload, &record); err != nil {
+				log.LOGGER.Errorf("failed to unmarshal queued message, dropping: %v", err)
+				if err := removeEntry(cursor, index, record.Message.GetID()); err != nil {
+					return err
+				}
+				removed = true
+				return nil
+			}
+
+			if time.Since(record.EnqueuedAt) > q.ttl {
+				log.LOGGER.Warnf("dropping offline-queued message %s, exceeded TTL", record.Message.GetID())
+				if err := removeEntry(cursor, index, record.Message.GetID()); err != nil {
+					return err
+				}
+				removed = true
+				return nil
+			}
+
+			if err := send(record.Message); err != nil {
+				return err
+			}
+			if err := removeEntry(cursor, index, record.Message.GetID()); err != nil {
+				return err
+			}
+			removed = true
+			return nil
+		})
+
+		if removed {
+			atomic.AddInt64(&q.size, -1)
+		}
+
+		if err == errOfflineQueueDrained {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (q *offlineQueue) Close() error {
+	return q.db.Close()
+}
+
+// dropOldest removes the oldest entries in messages until currentSize
+// (the caller's count of entries, taken from the running size counter
+// rather than a bucket walk) is back within maxSize, returning how many
+// entries it removed. Each iteration takes a fresh cursor positioned at
+// First before deleting, rather than deleting while stepping an existing
+// cursor forward with Next, since the latter is the documented boltdb
+// anti-pattern that silently skips entries (see removeEntry's doc comment).
+func dropOldest(messages, index *bolt.Bucket, currentSize, maxSize int) (int, error) {
+	removed := 0
+	for currentSize-removed > maxSize {
+		cursor := messages.Cursor()
+		key, payload := cursor.First()
+		if key == nil {
+			return removed, nil
+		}
+
+		var record queuedMessage
+		msgID := ""
+		if err := json.Unmarshal(payload, &record); err == nil {
+			msgID = record.Message.GetID()
+		}
+
+		log.LOGGER.Warnf("offline queue full, dropping oldest message %s", msgID)
+		if err := removeEntry(cursor, index, msgID); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// removeEntry deletes the entry cursor is currently positioned at from
+// its bucket, along with its secondary msgID index entry. It always uses
+// cursor.Delete() rather than bucket.Delete(key): deleting through the
+// bucket while a cursor is mid-iteration over the same bucket mutates
+// the in-memory node the cursor's position points into, which makes the
+// next Cursor.Next() skip over whatever entry shifted into the deleted
+// slot. cursor.Delete() is boltdb's sanctioned way to remove the current
+// entry without corrupting the cursor's iteration state.
+func removeEntry(cursor *bolt.Cursor, index *bolt.Bucket, msgID string) error {
+	if err := cursor.Delete(); err != nil {
+		return err
+	}
+	return index.Delete([]byte(msgID))
+}
+
+func seqKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
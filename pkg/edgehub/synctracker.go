@@ -0,0 +1,106 @@
+package edgehub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/kubeedge/kubeedge/beehive/pkg/core/model"
+)
+
+// syncTracker correlates outbound sync messages with their cloudhub
+// response, replacing the old syncKeeper map + keeperLock pair. Each
+// pending request is bound to the caller's context.Context, so a
+// canceled or expired context stops the wait without anyone else having
+// to reach in and tear the entry down.
+type syncTracker struct {
+	mu         sync.RWMutex
+	pending    map[string]chan model.Message
+	maxPending int
+}
+
+func newSyncTracker(maxPending int) *syncTracker {
+	if maxPending <= 0 {
+		maxPending = defaultSyncTrackerMaxPending
+	}
+	return &syncTracker{
+		pending:    make(map[string]chan model.Message),
+		maxPending: maxPending,
+	}
+}
+
+// Wait registers msgID as awaiting a response and blocks until it
+// arrives, ctx is done, or the tracker is already at its pending-request
+// limit. The registration is always cleaned up before Wait returns.
+func (t *syncTracker) Wait(ctx context.Context, msgID string) (model.Message, error) {
+	ch, err := t.register(msgID)
+	if err != nil {
+		return model.Message{}, err
+	}
+	defer t.forget(msgID)
+
+	select {
+	case response := <-ch:
+		return response, nil
+	case <-ctx.Done():
+		return model.Message{}, ctx.Err()
+	}
+}
+
+// Dispatch delivers message to the pending request keyed by parentID, if
+// one exists. It reports whether a waiter was found so callers can tell
+// a sync response from an ordinary unsolicited message.
+func (t *syncTracker) Dispatch(parentID string, message model.Message) bool {
+	t.mu.RLock()
+	ch, exist := t.pending[parentID]
+	t.mu.RUnlock()
+	if !exist {
+		return false
+	}
+
+	// ch has room for one response, so this send doesn't depend on the
+	// waiter already sitting in its select
+	select {
+	case ch <- message:
+	default:
+		// a response for this request is already buffered; drop the
+		// duplicate
+	}
+	return true
+}
+
+// IsPending reports whether msgID is currently awaiting a response.
+func (t *syncTracker) IsPending(msgID string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	_, exist := t.pending[msgID]
+	return exist
+}
+
+// PendingCount returns the number of sync requests currently awaiting a
+// response, surfaced by the keepalive goroutine so a cloudhub that stops
+// answering shows up before the pending set grows unbounded.
+func (t *syncTracker) PendingCount() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.pending)
+}
+
+func (t *syncTracker) register(msgID string) (chan model.Message, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.pending) >= t.maxPending {
+		return nil, fmt.Errorf("sync tracker at capacity (%d pending requests)", t.maxPending)
+	}
+
+	ch := make(chan model.Message, 1)
+	t.pending[msgID] = ch
+	return ch, nil
+}
+
+func (t *syncTracker) forget(msgID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.pending, msgID)
+}